@@ -0,0 +1,254 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const CACHE_DIRECTORY_NAME = "magus"
+
+// SourceSpecs is an ordered list of package sources: a plain local directory
+// ("dotfiles"), a git remote ("git+https://github.com/user/repo@ref"), or an
+// https tarball ("https://.../pkg.tar.gz#sha256=..."). It implements
+// flag.Value so "--source" can be repeated to configure several sources.
+type SourceSpecs []string
+
+func (s *SourceSpecs) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ",")
+}
+
+func (s *SourceSpecs) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// SourceSpec is one parsed entry from SourceSpecs.
+type SourceSpec struct {
+	Raw      string
+	Kind     string // "local", "git", or "tarball"
+	Location string
+	Ref      string // git ref, for Kind == "git"
+	SHA256   string // expected checksum, for Kind == "tarball"
+}
+
+func parseSourceSpec(raw string) SourceSpec {
+	if rest, ok := strings.CutPrefix(raw, "git+"); ok {
+		location, ref, _ := strings.Cut(rest, "@")
+		return SourceSpec{Raw: raw, Kind: "git", Location: location, Ref: ref}
+	}
+	if strings.HasPrefix(raw, "https://") || strings.HasPrefix(raw, "http://") {
+		location, fragment, _ := strings.Cut(raw, "#")
+		sha256sum, _ := strings.CutPrefix(fragment, "sha256=")
+		return SourceSpec{Raw: raw, Kind: "tarball", Location: location, SHA256: sha256sum}
+	}
+	return SourceSpec{Raw: raw, Kind: "local", Location: raw}
+}
+
+// cacheDir returns the local cache directory a remote spec is fetched into:
+// ~/.cache/magus/<hash of the spec>.
+func cacheDir(spec SourceSpec) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/.cache/%s/%s", home, CACHE_DIRECTORY_NAME, hashBytes([]byte(spec.Raw))[:16]), nil
+}
+
+// resolveSourceDir returns a local directory getPackages can read, fetching
+// and caching remote sources on first use.
+func resolveSourceDir(spec SourceSpec) (string, error) {
+	switch spec.Kind {
+	case "local":
+		return spec.Location, nil
+	case "git":
+		dir, err := cacheDir(spec)
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if err := gitClone(spec, dir); err != nil {
+				return "", err
+			}
+		}
+		return dir, nil
+	case "tarball":
+		dir, err := cacheDir(spec)
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if err := fetchTarball(spec, dir); err != nil {
+				return "", err
+			}
+		}
+		return dir, nil
+	}
+	return "", fmt.Errorf("unknown source kind %q for %q", spec.Kind, spec.Raw)
+}
+
+func gitClone(spec SourceSpec, dir string) error {
+	args := []string{"clone", "--depth", "1"}
+	if spec.Ref != "" {
+		args = append(args, "--branch", spec.Ref)
+	}
+	args = append(args, spec.Location, dir)
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func gitPull(dir string) error {
+	cmd := exec.Command("git", "-C", dir, "pull", "--ff-only")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func fetchTarball(spec SourceSpec, dir string) error {
+	if spec.SHA256 == "" {
+		return fmt.Errorf("fetching %s: refusing to fetch a tarball source without a #sha256=... fragment", spec.Location)
+	}
+
+	resp, err := http.Get(spec.Location)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: unexpected status %s", spec.Location, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body)
+	if got := hex.EncodeToString(sum[:]); got != spec.SHA256 {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", spec.Location, got, spec.SHA256)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	return extractTar(gz, dir)
+}
+
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, hdr.Name)
+		if rel, err := filepath.Rel(dir, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("extracting %s: entry %q escapes %s", dir, hdr.Name, dir)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0777); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode))
+			if err != nil {
+				return err
+			}
+			_, copyErr := io.Copy(f, tr)
+			closeErr := f.Close()
+			if copyErr != nil {
+				return copyErr
+			}
+			if closeErr != nil {
+				return closeErr
+			}
+		}
+	}
+}
+
+// getAllPackages resolves every configured source and merges their
+// packages, with later sources shadowing earlier ones by package name.
+func getAllPackages(sources SourceSpecs) ([]Package, error) {
+	byName := make(map[string]Package)
+	order := make([]string, 0)
+	for _, raw := range sources {
+		spec := parseSourceSpec(raw)
+		dir, err := resolveSourceDir(spec)
+		if err != nil {
+			return nil, fmt.Errorf("resolving source %q: %w", raw, err)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("reading source %q: %w", raw, err)
+		}
+		pkgs, err := getPackages(dir, entries)
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range pkgs {
+			pkg.sourceDir = dir
+			if _, shadowed := byName[pkg.name]; !shadowed {
+				order = append(order, pkg.name)
+			}
+			byName[pkg.name] = pkg
+		}
+	}
+	merged := make([]Package, 0, len(order))
+	for _, name := range order {
+		merged = append(merged, byName[name])
+	}
+	return merged, nil
+}
+
+// Update subcommand: refreshes every cached git checkout among the
+// configured sources.
+func Update(sources SourceSpecs) error {
+	for _, raw := range sources {
+		spec := parseSourceSpec(raw)
+		if spec.Kind != "git" {
+			continue
+		}
+		dir, err := cacheDir(spec)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			fmt.Fprintf(os.Stdout, ".:. Fetching %s\n", spec.Raw)
+			if err := gitClone(spec, dir); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintf(os.Stdout, ".:. Updating %s\n", spec.Raw)
+		if err := gitPull(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
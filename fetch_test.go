@@ -0,0 +1,126 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSourceSpec(t *testing.T) {
+	t.Run("local directory", func(t *testing.T) {
+		spec := parseSourceSpec("dotfiles")
+		if spec.Kind != "local" || spec.Location != "dotfiles" {
+			t.Errorf("got %+v, want local dotfiles", spec)
+		}
+	})
+
+	t.Run("git remote with ref", func(t *testing.T) {
+		spec := parseSourceSpec("git+https://github.com/user/repo@main")
+		if spec.Kind != "git" || spec.Location != "https://github.com/user/repo" || spec.Ref != "main" {
+			t.Errorf("got %+v, want git https://github.com/user/repo@main", spec)
+		}
+	})
+
+	t.Run("git remote without ref", func(t *testing.T) {
+		spec := parseSourceSpec("git+https://github.com/user/repo")
+		if spec.Kind != "git" || spec.Location != "https://github.com/user/repo" || spec.Ref != "" {
+			t.Errorf("got %+v, want git https://github.com/user/repo with no ref", spec)
+		}
+	})
+
+	t.Run("tarball with checksum", func(t *testing.T) {
+		spec := parseSourceSpec("https://example.com/pkg.tar.gz#sha256=abc123")
+		if spec.Kind != "tarball" || spec.Location != "https://example.com/pkg.tar.gz" || spec.SHA256 != "abc123" {
+			t.Errorf("got %+v, want tarball https://example.com/pkg.tar.gz sha256=abc123", spec)
+		}
+	})
+}
+
+func TestExtractTarRejectsPathTraversal(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "../../escape.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 4}); err != nil {
+		t.Fatalf("WriteHeader: %s", err)
+	}
+	if _, err := tw.Write([]byte("evil")); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	dir := t.TempDir()
+	if err := extractTar(&buf, dir); err == nil {
+		t.Errorf("extractTar accepted a tar entry escaping %s", dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "..", "..", "escape.txt")); !os.IsNotExist(err) {
+		t.Errorf("extractTar wrote a file outside %s", dir)
+	}
+}
+
+func TestFetchTarballRequiresChecksum(t *testing.T) {
+	spec := SourceSpec{Raw: "https://example.com/pkg.tar.gz", Location: "https://example.com/pkg.tar.gz"}
+	if err := fetchTarball(spec, t.TempDir()); err == nil {
+		t.Errorf("fetchTarball accepted a tarball source with no #sha256=...")
+	}
+}
+
+func TestFetchTarballRejectsChecksumMismatchBeforeExtract(t *testing.T) {
+	var tarball bytes.Buffer
+	gz := gzip.NewWriter(&tarball)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "payload.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 4}); err != nil {
+		t.Fatalf("WriteHeader: %s", err)
+	}
+	if _, err := tw.Write([]byte("evil")); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar Close: %s", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip Close: %s", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball.Bytes())
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	wantSHA256 := strings.Repeat("0", 64)
+	spec := SourceSpec{Raw: server.URL, Location: server.URL, SHA256: wantSHA256}
+	if err := fetchTarball(spec, dir); err == nil {
+		t.Errorf("fetchTarball accepted a checksum mismatch")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "payload.txt")); !os.IsNotExist(err) {
+		t.Errorf("fetchTarball extracted before validating the checksum")
+	}
+}
+
+func TestGetAllPackagesShadowsByName(t *testing.T) {
+	base, err := getAllPackages(SourceSpecs{"testdata/dotfiles"})
+	if err != nil {
+		t.Fatalf("getAllPackages returned error: %s", err)
+	}
+
+	merged, err := getAllPackages(SourceSpecs{"testdata/dotfiles", "testdata/dotfiles"})
+	if err != nil {
+		t.Fatalf("getAllPackages returned error: %s", err)
+	}
+
+	if len(merged) != len(base) {
+		t.Errorf("got %d packages after shadowing, want %d", len(merged), len(base))
+	}
+	for _, pkg := range merged {
+		if pkg.sourceDir != "testdata/dotfiles" {
+			t.Errorf("package %q has sourceDir %q, want testdata/dotfiles", pkg.name, pkg.sourceDir)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Package keyring manages the OpenPGP signers magus trusts when verifying
+// package signatures, without shelling out to gpg.
+package keyring
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+const PUBRING_FILE_NAME = "pubring.gpg"
+const SECRING_FILE_NAME = "secring.gpg"
+
+// NewKeyPair generates a fresh OpenPGP entity for name/comment/email, for
+// users provisioning a new signer identity under ~/.gnupg.
+func NewKeyPair(name string, comment string, email string) (*openpgp.Entity, error) {
+	return openpgp.NewEntity(name, comment, email, nil)
+}
+
+// ListKeys reads every public key out of gnupgHome/pubring.gpg into an
+// EntityList that package signatures can be checked against.
+func ListKeys(gnupgHome string) (openpgp.EntityList, error) {
+	f, err := os.Open(fmt.Sprintf("%s/%s", gnupgHome, PUBRING_FILE_NAME))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return openpgp.ReadKeyRing(f)
+}
+
+// ListSecretKeys reads every private key out of gnupgHome/secring.gpg into
+// an EntityList that Sign can pick a signer from. Entities loaded from
+// pubring.gpg never carry a PrivateKey, so signing must read this ring
+// instead of ListKeys.
+func ListSecretKeys(gnupgHome string) (openpgp.EntityList, error) {
+	f, err := os.Open(fmt.Sprintf("%s/%s", gnupgHome, SECRING_FILE_NAME))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return openpgp.ReadKeyRing(f)
+}
+
+// Import reads an armored public key from r and appends it to
+// gnupgHome/pubring.gpg, so future signature checks trust that signer.
+func Import(gnupgHome string, r io.Reader) (*openpgp.Entity, error) {
+	imported, err := openpgp.ReadArmoredKeyRing(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(imported) == 0 {
+		return nil, fmt.Errorf("no keys found in import")
+	}
+	f, err := os.OpenFile(fmt.Sprintf("%s/%s", gnupgHome, PUBRING_FILE_NAME), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	for _, entity := range imported {
+		if err := entity.Serialize(f); err != nil {
+			return nil, err
+		}
+	}
+	return imported[0], nil
+}
@@ -25,7 +25,6 @@ SOFTWARE.
 package main
 
 import (
-	"crypto/md5"
 	"errors"
 	"flag"
 	"fmt"
@@ -40,44 +39,92 @@ const (
 	ABSENT = "ABSENT"
 	PRESENT = "PRESENT"
 	MISMATCH = "MISMATCH"
+	LINKED = "LINKED"
 )
 
 func main() {
+	homeDir := getHomeDirectory()
 	opts := &Options{
-		Source: DEFAULT_SOURCE_DIRECTORY,
-		Target: getHomeDirectory(),
+		Target:  homeDir,
+		Keyring: fmt.Sprintf("%s/.gnupg", homeDir),
 	}
-	if err := opts.Parse(os.Args[1], os.Args[2:]); err != nil {
+	cmd := os.Args[1]
+	if err := opts.Parse(cmd, os.Args[2:]); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing options: %s\n", err)
 		os.Exit(EXIT_ERROR)
 	}
 
-	cmd := os.Args[1]
-	if cmd != "conjure" && cmd != "expel" && cmd != "peer" {
+	if cmd == "verify" {
+		drifted, err := Verify(opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Verify command failed with error: %s\n", err)
+			os.Exit(EXIT_ERROR)
+		}
+		if drifted {
+			os.Exit(EXIT_ERROR)
+		}
+		return
+	}
+
+	if cmd == "update" {
+		if err := Update(opts.Source); err != nil {
+			fmt.Fprintf(os.Stderr, "Update command failed with error: %s\n", err)
+			os.Exit(EXIT_ERROR)
+		}
+		return
+	}
+
+	if cmd != "conjure" && cmd != "expel" && cmd != "peer" && cmd != "sign" {
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", cmd)
 		os.Exit(EXIT_ERROR)
 	}
 
-	files, err := os.ReadDir(opts.Source)
+	packages, err := getAllPackages(opts.Source)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading directory %s: %s", opts.Source, err)
+		fmt.Fprintf(os.Stderr, "Error loading packages: %s\n", err)
+		os.Exit(EXIT_ERROR)
+	}
+	templateCtx, err := buildTemplateContext(getHomeDirectory())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error building template context: %s\n", err)
 		os.Exit(EXIT_ERROR)
 	}
-	packages := getPackages(files)
 	for idx, pkg := range packages {
-		foundPaths := getFiles(fmt.Sprintf("%s/%s", opts.Source, pkg.name))
+		pkgDir := fmt.Sprintf("%s/%s", pkg.sourceDir, pkg.name)
+		foundPaths := getFiles(pkgDir)
+		ignorePatterns := append(append([]string{}, defaultIgnorePatterns...), pkg.manifest.Ignore...)
 		for _, path := range foundPaths {
+			if shouldIgnore(path, ignorePatterns) {
+				continue
+			}
+			isTmpl := isTemplateFile(path)
+			installPath := path
+			if isTmpl {
+				installPath = templateInstallPath(path)
+			}
 			pkgFile := PackageFile{
-				path: path,
+				path:       path,
+				target:     resolveTarget(pkg.manifest, installPath),
+				isTemplate: isTmpl,
 			}
-			relativePath := fmt.Sprintf("%s/%s/%s", opts.Source, pkg.name, path)
-			content, err := os.ReadFile(relativePath)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error reading %s: %s\n", relativePath, err)
-				os.Exit(EXIT_ERROR)
+			relativePath := fmt.Sprintf("%s/%s/%s", pkg.sourceDir, pkg.name, path)
+			var digest string
+			if isTmpl {
+				rendered, err := renderTemplateFile(relativePath, templateCtx)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error rendering %s: %s\n", relativePath, err)
+					os.Exit(EXIT_ERROR)
+				}
+				digest = hashBytes(rendered)
+			} else {
+				digest, err = hashFile(relativePath)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error hashing %s: %s\n", relativePath, err)
+					os.Exit(EXIT_ERROR)
+				}
 			}
-			pkgFile.md5 = getHash(content)
-			state, err := determineState(pkgFile.path, pkgFile.md5, opts.Target)
+			pkgFile.digest = digest
+			state, err := determineState(pkgFile, opts.Target, pkgDir)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error determining current state of file %s in package \"%s\": %s", pkgFile.path, pkg.name, err)
 				os.Exit(EXIT_ERROR)
@@ -89,41 +136,70 @@ func main() {
 
 	switch cmd {
 	case "conjure":
-		if err := Conjure(packages, opts); err != nil {
+		if err := Conjure(packages, opts, templateCtx); err != nil {
 			fmt.Fprintf(os.Stderr, "Conjure command failed with error: %s\n", err)
 			os.Exit(EXIT_ERROR)
 		}
+		if err := persistState(packages, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error persisting state manifest: %s\n", err)
+			os.Exit(EXIT_ERROR)
+		}
 	case "expel":
 		if err := Expel(packages, opts); err != nil {
 			fmt.Fprintf(os.Stderr, "Expel command failed with error: %s\n", err)
 			os.Exit(EXIT_ERROR)
 		}
+		if err := persistState(packages, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error persisting state manifest: %s\n", err)
+			os.Exit(EXIT_ERROR)
+		}
 	case "peer":
 		if err := Peer(packages, opts); err != nil {
 			fmt.Fprintf(os.Stderr, "Peer command failed with error: %s\n", err)
 			os.Exit(EXIT_ERROR)
 		}
+	case "sign":
+		if err := Sign(packages, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Sign command failed with error: %s\n", err)
+			os.Exit(EXIT_ERROR)
+		}
 	}
 }
 
 // Options struct
 type Options struct {
-	Source string
-	Target string
+	Source           SourceSpecs
+	Target           string
+	Link             bool
+	Adopt            bool
+	VerifySignatures bool
+	Keyring          string
 }
 
 func (opts *Options) Parse(cmd string, args []string) error {
 	cli := flag.NewFlagSet(cmd, flag.ExitOnError)
-	cli.StringVar(&opts.Source, "source", opts.Source, "Source path for packages")
+	cli.Var(&opts.Source, "source", "Source path for packages (repeatable; local dir, git+https://..@ref, or https://..tar.gz#sha256=..)")
 	cli.StringVar(&opts.Target, "target", opts.Target, "Target destination for packages")
-	return cli.Parse(args)
+	cli.BoolVar(&opts.Link, "link", opts.Link, "Symlink package files into Target instead of copying them")
+	cli.BoolVar(&opts.Adopt, "adopt", opts.Adopt, "With --link, move a conflicting Target file into the package before linking")
+	cli.BoolVar(&opts.VerifySignatures, "verify", opts.VerifySignatures, "Refuse to conjure a package whose .magus.sig doesn't check out against --keyring")
+	cli.StringVar(&opts.Keyring, "keyring", opts.Keyring, "Directory of trusted OpenPGP public keys (pubring.gpg)")
+	if err := cli.Parse(args); err != nil {
+		return err
+	}
+	if len(opts.Source) == 0 {
+		opts.Source = SourceSpecs{DEFAULT_SOURCE_DIRECTORY}
+	}
+	return nil
 }
 
 // Package struct
 type Package struct {
-	name  string
-	files []PackageFile
-	state string
+	name      string
+	files     []PackageFile
+	state     string
+	manifest  Manifest
+	sourceDir string
 }
 
 func (p *Package) addFile(pf PackageFile) []PackageFile {
@@ -132,9 +208,11 @@ func (p *Package) addFile(pf PackageFile) []PackageFile {
 }
 
 type PackageFile struct {
-	path string
-	md5 string
-	state string
+	path       string
+	target     string
+	digest     string
+	state      string
+	isTemplate bool
 }
 
 func getHomeDirectory() string {
@@ -146,18 +224,23 @@ func getHomeDirectory() string {
 	return dir
 }
 
-func getPackages(entries []fs.DirEntry) []Package {
+func getPackages(root string, entries []fs.DirEntry) ([]Package, error) {
 	pkgs := make([]Package, 0)
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
 		}
+		manifest, err := loadManifest(fmt.Sprintf("%s/%s", root, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("package %q: %w", entry.Name(), err)
+		}
 		pkg := Package{
-			name: entry.Name(),
+			name:     entry.Name(),
+			manifest: manifest,
 		}
 		pkgs = append(pkgs, pkg)
 	}
-	return pkgs
+	return pkgs, nil
 }
 
 func getFiles(root string) []string {
@@ -178,30 +261,51 @@ func getFiles(root string) []string {
 	return files
 }
 
-func getHash(content []byte) string {
-	hash := md5.New()
-	hash.Write(content)
-	return fmt.Sprintf("%x", hash.Sum(nil))
-}
-
-func determineState(file string, md5 string, targetPath string) (string, error) {
-	targetFile := fmt.Sprintf("%s/%s", targetPath, file)
-	if !checkFileExists(targetFile) {
+func determineState(pkgFile PackageFile, targetPath string, pkgSourceDir string) (string, error) {
+	targetFile := fmt.Sprintf("%s/%s", targetPath, pkgFile.target)
+	info, err := os.Lstat(targetFile)
+	if errors.Is(err, os.ErrNotExist) {
 		return ABSENT, nil
 	}
-	content, err := os.ReadFile(targetFile)
 	if err != nil {
 		return "", err
 	}
-	if !(md5 == getHash(content)) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return determineLinkState(targetFile, pkgFile.path, pkgSourceDir)
+	}
+	digest, err := hashFile(targetFile)
+	if err != nil {
+		return "", err
+	}
+	if !(pkgFile.digest == digest) {
 		return MISMATCH, nil
 	}
 	return PRESENT, nil
 }
 
-func checkFileExists(path string) bool {
-	_, err := os.Stat(path)
-	return !errors.Is(err, os.ErrNotExist)
+// determineLinkState reports LINKED when targetFile is a symlink resolving to
+// file's canonical location inside pkgSourceDir, and MISMATCH otherwise (a
+// symlink pointing anywhere else is treated the same as conflicting content).
+func determineLinkState(targetFile string, file string, pkgSourceDir string) (string, error) {
+	linkDest, err := os.Readlink(targetFile)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(linkDest) {
+		linkDest = filepath.Join(filepath.Dir(targetFile), linkDest)
+	}
+	gotAbs, err := filepath.Abs(linkDest)
+	if err != nil {
+		return "", err
+	}
+	wantAbs, err := filepath.Abs(filepath.Join(pkgSourceDir, file))
+	if err != nil {
+		return "", err
+	}
+	if gotAbs == wantAbs {
+		return LINKED, nil
+	}
+	return MISMATCH, nil
 }
 
 func copyFile(pkgFile PackageFile, pkgName string, sourcePath string, targetPath string) error {
@@ -210,7 +314,7 @@ func copyFile(pkgFile PackageFile, pkgName string, sourcePath string, targetPath
 	if err != nil {
 		return err
 	}
-	fullTargetfilePath := fmt.Sprintf("%s/%s", targetPath, pkgFile.path)
+	fullTargetfilePath := fmt.Sprintf("%s/%s", targetPath, pkgFile.target)
 	fullTargetFileParents := filepath.Dir(fullTargetfilePath)
 	if err := os.MkdirAll(fullTargetFileParents, 0777); err != nil {
 		return err
@@ -221,40 +325,147 @@ func copyFile(pkgFile PackageFile, pkgName string, sourcePath string, targetPath
 	return nil
 }
 
+// renderAndWriteFile installs a .tmpl package file by rendering it against
+// templateCtx and writing the result to targetPath/pkgFile.target, so the
+// same template can serve different hosts without ever being symlinked.
+func renderAndWriteFile(pkgFile PackageFile, pkgName string, sourcePath string, targetPath string, templateCtx TemplateContext) error {
+	fullSourceFilePath := fmt.Sprintf("%s/%s/%s", sourcePath, pkgName, pkgFile.path)
+	rendered, err := renderTemplateFile(fullSourceFilePath, templateCtx)
+	if err != nil {
+		return err
+	}
+	fullTargetFilePath := fmt.Sprintf("%s/%s", targetPath, pkgFile.target)
+	if err := os.MkdirAll(filepath.Dir(fullTargetFilePath), 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(fullTargetFilePath, rendered, 0666)
+}
+
 func rmFile(pkgFile PackageFile, targetPath string) error {
-	fullTargetfilePath := fmt.Sprintf("%s/%s", targetPath, pkgFile.path)
+	fullTargetfilePath := fmt.Sprintf("%s/%s", targetPath, pkgFile.target)
 	if err := os.Remove(fullTargetfilePath); err != nil {
 		return err
 	}
 	return nil
 }
 
+// linkFile creates a relative symlink at targetPath/pkgFile.target pointing
+// back into sourcePath/pkgName/pkgFile.path, creating parent dirs as needed.
+func linkFile(pkgFile PackageFile, pkgName string, sourcePath string, targetPath string) error {
+	fullSourceFilePath := fmt.Sprintf("%s/%s/%s", sourcePath, pkgName, pkgFile.path)
+	fullTargetFilePath := fmt.Sprintf("%s/%s", targetPath, pkgFile.target)
+	fullTargetFileParents := filepath.Dir(fullTargetFilePath)
+	if err := os.MkdirAll(fullTargetFileParents, 0777); err != nil {
+		return err
+	}
+	relSourceFilePath, err := filepath.Rel(fullTargetFileParents, fullSourceFilePath)
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(relSourceFilePath, fullTargetFilePath); err != nil {
+		return err
+	}
+	return nil
+}
+
+// adoptFile moves an existing Target file into the package directory so it
+// can be linked back in, letting users bootstrap a package from files
+// already living in $HOME.
+func adoptFile(pkgFile PackageFile, pkgName string, sourcePath string, targetPath string) error {
+	fullSourceFilePath := fmt.Sprintf("%s/%s/%s", sourcePath, pkgName, pkgFile.path)
+	fullTargetFilePath := fmt.Sprintf("%s/%s", targetPath, pkgFile.target)
+	if err := os.MkdirAll(filepath.Dir(fullSourceFilePath), 0777); err != nil {
+		return err
+	}
+	if err := os.Rename(fullTargetFilePath, fullSourceFilePath); err != nil {
+		return err
+	}
+	return nil
+}
+
 // Conjure subcommand
-func Conjure(pkgs []Package, opts *Options) error {
-	for _, pkg := range pkgs {
+func Conjure(pkgs []Package, opts *Options, templateCtx TemplateContext) error {
+	ordered, err := resolvePackageOrder(pkgs)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range ordered {
+		if opts.VerifySignatures {
+			if err := verifyPackageSignature(pkg, opts); err != nil {
+				fmt.Fprintf(os.Stderr, "  refusing to conjure %s: %s\n", pkg.name, err)
+				continue
+			}
+		}
+		pkgDir := fmt.Sprintf("%s/%s", pkg.sourceDir, pkg.name)
+		if err := runHook(pkg.manifest.PreConjure, pkgDir); err != nil {
+			return err
+		}
 		fmt.Fprintf(os.Stdout, ".:. Conjuring %s\n", pkg.name)
 		for _, fn := range pkg.files {
-			if fn.state == ABSENT || fn.state == MISMATCH {
-				if err := copyFile(fn, pkg.name, opts.Source, opts.Target); err != nil {
+			if fn.isTemplate {
+				if fn.state == ABSENT || fn.state == MISMATCH {
+					if err := renderAndWriteFile(fn, pkg.name, pkg.sourceDir, opts.Target, templateCtx); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if !opts.Link {
+				if fn.state == ABSENT || fn.state == MISMATCH {
+					if err := copyFile(fn, pkg.name, pkg.sourceDir, opts.Target); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if fn.state == LINKED {
+				continue
+			}
+			if fn.state == MISMATCH {
+				if !opts.Adopt {
+					fmt.Fprintf(os.Stderr, "  conflict: %s already exists and differs from %s/%s/%s (use --adopt to absorb it)\n", fn.target, pkg.sourceDir, pkg.name, fn.path)
+					continue
+				}
+				if err := adoptFile(fn, pkg.name, pkg.sourceDir, opts.Target); err != nil {
 					return err
 				}
 			}
+			if err := linkFile(fn, pkg.name, pkg.sourceDir, opts.Target); err != nil {
+				return err
+			}
+		}
+		if err := runHook(pkg.manifest.PostConjure, pkgDir); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-// Expel subcommand
+// Expel subcommand: tears packages down in the reverse of conjure's
+// dependency order, so a dependent is fully expelled (files removed, hooks
+// run) before the dependency it requires.
 func Expel(pkgs []Package, opts *Options) error {
-	for _, pkg := range pkgs {
+	ordered, err := resolvePackageOrder(pkgs)
+	if err != nil {
+		return err
+	}
+	for i := len(ordered) - 1; i >= 0; i-- {
+		pkg := ordered[i]
+		pkgDir := fmt.Sprintf("%s/%s", pkg.sourceDir, pkg.name)
+		if err := runHook(pkg.manifest.PreExpel, pkgDir); err != nil {
+			return err
+		}
 		fmt.Fprintf(os.Stdout, ".:. Expelling %s\n", pkg.name)
-		 for _, fn := range pkg.files {
-			 if fn.state == PRESENT {
+		for _, fn := range pkg.files {
+			if fn.state == PRESENT || fn.state == LINKED {
 				if err := rmFile(fn, opts.Target); err != nil {
 					return err
 				}
 			}
 		}
+		if err := runHook(pkg.manifest.PostExpel, pkgDir); err != nil {
+			return err
+		}
 	}
 	return nil
 }
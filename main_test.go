@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"slices"
 	"testing"
@@ -12,10 +14,13 @@ func TestGetPackages(t *testing.T) {
 	want := []Package{
 		{name: "test-pkg"},
 	}
-	got := getPackages(files)
+	got, err := getPackages("testdata/dotfiles", files)
+	if err != nil {
+		t.Fatalf("getPackages returned error: %s", err)
+	}
 
 	if !reflect.DeepEqual(got, want) {
-		t.Errorf("got %s, want %s", got, want)
+		t.Errorf("got %v, want %v", got, want)
 	}
 }
 
@@ -29,11 +34,12 @@ func TestGetFiles(t *testing.T) {
 	}
 }
 
-func TestGetHash(t *testing.T) {
-	test_string := []byte("test string")
-	want := "6f8db599de986fab7a21625b7916589c"
-	got := getHash(test_string)
-
+func TestHashFile(t *testing.T) {
+	want := "e9b11d087c5a8319d9ca76e1a98f4be6f5ba249088391e840a1d7058cab744cb"
+	got, err := hashFile("testdata/dotfiles/test-pkg/.testpkgrc")
+	if err != nil {
+		t.Fatalf("hashFile returned error: %s", err)
+	}
 	if got != want {
 		t.Errorf("got %s want %s", got, want)
 	}
@@ -43,7 +49,8 @@ func TestDetermineState(t *testing.T) {
 
 	t.Run("determine present state", func(t *testing.T) {
 		want := "PRESENT"
-		got, _ := determineState(".testpkgrc", "f299060e0383392ebeac64b714eca7e3", "testdata/dotfiles/test-pkg")
+		pf := PackageFile{path: ".testpkgrc", target: ".testpkgrc", digest: "e9b11d087c5a8319d9ca76e1a98f4be6f5ba249088391e840a1d7058cab744cb"}
+		got, _ := determineState(pf, "testdata/dotfiles/test-pkg", "testdata/dotfiles/test-pkg")
 		if got != want {
 			t.Errorf("got %s, want %s", got, want)
 		}
@@ -51,7 +58,8 @@ func TestDetermineState(t *testing.T) {
 
 	t.Run("determine absent state", func(t *testing.T) {
 		want := "ABSENT"
-		got, _ := determineState(".fakerc", "123456", "testdata/dotfiles/test-pkg")
+		pf := PackageFile{path: ".fakerc", target: ".fakerc", digest: "123456"}
+		got, _ := determineState(pf, "testdata/dotfiles/test-pkg", "testdata/dotfiles/test-pkg")
 
 		if got != want {
 			t.Errorf("got %s, want %s", got, want)
@@ -60,11 +68,78 @@ func TestDetermineState(t *testing.T) {
 
 	t.Run("determine mismatch state", func(t *testing.T) {
 		want := "MISMATCH"
-		got, _ := determineState(".testpkgrc", "123456789", "testdata/dotfiles/test-pkg")
+		pf := PackageFile{path: ".testpkgrc", target: ".testpkgrc", digest: "123456789"}
+		got, _ := determineState(pf, "testdata/dotfiles/test-pkg", "testdata/dotfiles/test-pkg")
+
+		if got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
 
+}
+
+func TestExpelRunsDependentsBeforeDependencies(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "order.log")
+	sourceDir := t.TempDir()
+	hookFor := func(name string) string {
+		return fmt.Sprintf("echo %s >> %s", name, logPath)
+	}
+	pkgs := []Package{
+		{name: "zsh", sourceDir: sourceDir, manifest: Manifest{Requires: []string{"base"}, PreExpel: hookFor("zsh")}},
+		{name: "base", sourceDir: sourceDir, manifest: Manifest{PreExpel: hookFor("base")}},
+	}
+	for _, pkg := range pkgs {
+		if err := os.MkdirAll(filepath.Join(sourceDir, pkg.name), 0777); err != nil {
+			t.Fatalf("failed to set up fixture: %s", err)
+		}
+	}
+
+	if err := Expel(pkgs, &Options{Target: t.TempDir()}); err != nil {
+		t.Fatalf("Expel returned error: %s", err)
+	}
+
+	logged, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("reading hook log: %s", err)
+	}
+	want := "zsh\nbase\n"
+	if got := string(logged); got != want {
+		t.Errorf("hook run order = %q, want %q (dependent zsh should expel before its dependency base)", got, want)
+	}
+}
+
+func TestDetermineStateLinked(t *testing.T) {
+	tmpTarget := t.TempDir()
+	pkgSourceDir := "testdata/dotfiles/test-pkg"
+	absSourceFile, _ := filepath.Abs(filepath.Join(pkgSourceDir, ".testpkgrc"))
+	targetFile := filepath.Join(tmpTarget, ".testpkgrc")
+
+	t.Run("determine linked state", func(t *testing.T) {
+		if err := os.Symlink(absSourceFile, targetFile); err != nil {
+			t.Fatalf("failed to set up symlink fixture: %s", err)
+		}
+		want := "LINKED"
+		pf := PackageFile{path: ".testpkgrc", target: ".testpkgrc", digest: "e9b11d087c5a8319d9ca76e1a98f4be6f5ba249088391e840a1d7058cab744cb"}
+		got, _ := determineState(pf, tmpTarget, pkgSourceDir)
+		if got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
+
+	t.Run("determine mismatch state for symlink pointing elsewhere", func(t *testing.T) {
+		elsewhere := filepath.Join(tmpTarget, "elsewhere")
+		if err := os.WriteFile(elsewhere, []byte("test string"), 0666); err != nil {
+			t.Fatalf("failed to set up fixture: %s", err)
+		}
+		strayLink := filepath.Join(tmpTarget, ".straylink")
+		if err := os.Symlink(elsewhere, strayLink); err != nil {
+			t.Fatalf("failed to set up symlink fixture: %s", err)
+		}
+		want := "MISMATCH"
+		pf := PackageFile{path: ".straylink", target: ".straylink", digest: "e9b11d087c5a8319d9ca76e1a98f4be6f5ba249088391e840a1d7058cab744cb"}
+		got, _ := determineState(pf, tmpTarget, pkgSourceDir)
 		if got != want {
 			t.Errorf("got %s, want %s", got, want)
 		}
 	})
-	
 }
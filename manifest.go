@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	MANIFEST_FILE_NAME = "magus.yaml"
+	MANIFEST_FILE_NAME_ALT = ".magusrc"
+)
+
+// defaultIgnorePatterns are skipped in every package even without a manifest,
+// since nobody wants their package metadata or VCS internals conjured into Target.
+var defaultIgnorePatterns = []string{
+	".git",
+	"README.md",
+	"*.swp",
+	"*.swo",
+	"*~",
+	MANIFEST_FILE_NAME,
+	MANIFEST_FILE_NAME_ALT,
+	SIGNATURE_FILE_NAME,
+}
+
+// Manifest holds the optional per-package metadata loaded from magus.yaml (or
+// .magusrc) during getPackages.
+type Manifest struct {
+	Ignore      []string                     `yaml:"ignore"`
+	Target      map[string]map[string]string `yaml:"target"`
+	Requires    []string                     `yaml:"requires"`
+	PreConjure  string                       `yaml:"pre_conjure"`
+	PostConjure string                       `yaml:"post_conjure"`
+	PreExpel    string                       `yaml:"pre_expel"`
+	PostExpel   string                       `yaml:"post_expel"`
+}
+
+// loadManifest reads magus.yaml or .magusrc from pkgDir, returning a zero
+// Manifest when a package declares neither.
+func loadManifest(pkgDir string) (Manifest, error) {
+	for _, name := range []string{MANIFEST_FILE_NAME, MANIFEST_FILE_NAME_ALT} {
+		data, err := os.ReadFile(fmt.Sprintf("%s/%s", pkgDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Manifest{}, err
+		}
+		var manifest Manifest
+		if err := yaml.Unmarshal(data, &manifest); err != nil {
+			return Manifest{}, fmt.Errorf("%s/%s: %w", pkgDir, name, err)
+		}
+		return manifest, nil
+	}
+	return Manifest{}, nil
+}
+
+// shouldIgnore reports whether relPath matches one of patterns, either as a
+// whole-path glob, a basename glob, or a leading path segment (so "ignore:
+// [.git]" also skips everything underneath .git/).
+func shouldIgnore(relPath string, patterns []string) bool {
+	base := filepath.Base(relPath)
+	first := strings.SplitN(relPath, "/", 2)[0]
+	for _, pattern := range patterns {
+		if pattern == first || pattern == base {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, base); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, relPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTarget looks up a manifest "target:" override for path, preferring
+// an entry for the current GOOS and falling back to "default". Packages
+// without an override install to the same relative path in Target.
+func resolveTarget(manifest Manifest, path string) string {
+	overrides, ok := manifest.Target[path]
+	if !ok {
+		return path
+	}
+	if target, ok := overrides[runtime.GOOS]; ok {
+		return target
+	}
+	if target, ok := overrides["default"]; ok {
+		return target
+	}
+	return path
+}
+
+// resolvePackageOrder topologically sorts pkgs by their manifest "requires:"
+// lists, so dependencies come before their dependents. Conjure walks this
+// order forward; Expel walks it in reverse, so dependents are torn down
+// before the dependencies they require. It fails fast on an unknown package
+// name or a requires cycle.
+func resolvePackageOrder(pkgs []Package) ([]Package, error) {
+	byName := make(map[string]Package, len(pkgs))
+	for _, pkg := range pkgs {
+		byName[pkg.name] = pkg
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(pkgs))
+	ordered := make([]Package, 0, len(pkgs))
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("cyclic requires: package %q depends on itself transitively", name)
+		}
+		state[name] = visiting
+		pkg := byName[name]
+		for _, dep := range pkg.manifest.Requires {
+			if _, ok := byName[dep]; !ok {
+				return fmt.Errorf("package %q requires unknown package %q", name, dep)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		ordered = append(ordered, pkg)
+		return nil
+	}
+
+	for _, pkg := range pkgs {
+		if err := visit(pkg.name); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// runHook runs script, a shell hook such as pre_conjure or post_expel, with
+// dir as its working directory. A blank script is a no-op.
+func runHook(script string, dir string) error {
+	if script == "" {
+		return nil
+	}
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestLoadManifestMissing(t *testing.T) {
+	got, err := loadManifest("testdata/dotfiles/test-pkg")
+	if err != nil {
+		t.Fatalf("loadManifest returned error: %s", err)
+	}
+	want := Manifest{}
+	if len(got.Ignore) != 0 || got.Requires != nil {
+		t.Errorf("got %+v, want zero-value Manifest %+v", got, want)
+	}
+}
+
+func TestShouldIgnore(t *testing.T) {
+	patterns := append([]string{}, defaultIgnorePatterns...)
+
+	cases := map[string]bool{
+		".git":                 true,
+		".git/hooks/pre-commit": true,
+		"README.md":            true,
+		"magus.yaml":           true,
+		".vimrc.swp":           true,
+		".testpkgrc":           false,
+		".local/share/testfile": false,
+	}
+
+	for path, want := range cases {
+		if got := shouldIgnore(path, patterns); got != want {
+			t.Errorf("shouldIgnore(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	manifest := Manifest{
+		Target: map[string]map[string]string{
+			"config/nvim/init.lua": {
+				"linux":   ".config/nvim/init.lua",
+				"default": "Library/Application Support/nvim/init.lua",
+			},
+		},
+	}
+
+	t.Run("no override", func(t *testing.T) {
+		want := ".bashrc"
+		got := resolveTarget(manifest, ".bashrc")
+		if got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
+
+	t.Run("prefers GOOS override, else default", func(t *testing.T) {
+		want := "Library/Application Support/nvim/init.lua"
+		if runtime.GOOS == "linux" {
+			want = ".config/nvim/init.lua"
+		}
+		got := resolveTarget(manifest, "config/nvim/init.lua")
+		if got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
+}
+
+func TestResolvePackageOrder(t *testing.T) {
+	t.Run("orders dependencies first", func(t *testing.T) {
+		pkgs := []Package{
+			{name: "zsh", manifest: Manifest{Requires: []string{"base"}}},
+			{name: "base"},
+		}
+		ordered, err := resolvePackageOrder(pkgs)
+		if err != nil {
+			t.Fatalf("resolvePackageOrder returned error: %s", err)
+		}
+		if ordered[0].name != "base" || ordered[1].name != "zsh" {
+			t.Errorf("got order %v, want [base zsh]", []string{ordered[0].name, ordered[1].name})
+		}
+	})
+
+	t.Run("fails on unknown dependency", func(t *testing.T) {
+		pkgs := []Package{
+			{name: "zsh", manifest: Manifest{Requires: []string{"nonexistent"}}},
+		}
+		if _, err := resolvePackageOrder(pkgs); err == nil {
+			t.Error("expected an error for an unknown required package, got nil")
+		}
+	})
+
+	t.Run("fails on cycle", func(t *testing.T) {
+		pkgs := []Package{
+			{name: "a", manifest: Manifest{Requires: []string{"b"}}},
+			{name: "b", manifest: Manifest{Requires: []string{"a"}}},
+		}
+		if _, err := resolvePackageOrder(pkgs); err == nil {
+			t.Error("expected an error for a requires cycle, got nil")
+		}
+	})
+}
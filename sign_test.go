@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+
+	"magus/keyring"
+)
+
+// writeKeyringDir serializes entity's secret and public keys into a fresh
+// gnupg-style directory, the way sign_test's fixtures stand in for a real
+// ~/.gnupg without shelling out to gpg.
+func writeKeyringDir(t *testing.T, entity *openpgp.Entity) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	secring, err := os.Create(filepath.Join(dir, keyring.SECRING_FILE_NAME))
+	if err != nil {
+		t.Fatalf("creating secring.gpg: %s", err)
+	}
+	if err := entity.SerializePrivate(secring, nil); err != nil {
+		t.Fatalf("serializing private key: %s", err)
+	}
+	if err := secring.Close(); err != nil {
+		t.Fatalf("closing secring.gpg: %s", err)
+	}
+
+	pubring, err := os.Create(filepath.Join(dir, keyring.PUBRING_FILE_NAME))
+	if err != nil {
+		t.Fatalf("creating pubring.gpg: %s", err)
+	}
+	if err := entity.Serialize(pubring); err != nil {
+		t.Fatalf("serializing public key: %s", err)
+	}
+	if err := pubring.Close(); err != nil {
+		t.Fatalf("closing pubring.gpg: %s", err)
+	}
+
+	return dir
+}
+
+func testPackage(t *testing.T, content string) Package {
+	t.Helper()
+	sourceDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(sourceDir, "shell"), 0777); err != nil {
+		t.Fatalf("failed to set up fixture: %s", err)
+	}
+	return Package{
+		name:      "shell",
+		sourceDir: sourceDir,
+		files:     []PackageFile{{path: ".bashrc", digest: hashBytes([]byte(content))}},
+	}
+}
+
+func TestSignAndVerifyRoundTrip(t *testing.T) {
+	entity, err := keyring.NewKeyPair("Signer", "", "signer@example.com")
+	if err != nil {
+		t.Fatalf("NewKeyPair returned error: %s", err)
+	}
+	opts := &Options{Keyring: writeKeyringDir(t, entity)}
+	pkg := testPackage(t, "export PATH")
+
+	if err := Sign([]Package{pkg}, opts); err != nil {
+		t.Fatalf("Sign returned error: %s", err)
+	}
+	if err := verifyPackageSignature(pkg, opts); err != nil {
+		t.Errorf("verifyPackageSignature rejected a correctly signed package: %s", err)
+	}
+}
+
+func TestVerifyPackageSignatureRejectsTamperedManifest(t *testing.T) {
+	entity, err := keyring.NewKeyPair("Signer", "", "signer@example.com")
+	if err != nil {
+		t.Fatalf("NewKeyPair returned error: %s", err)
+	}
+	opts := &Options{Keyring: writeKeyringDir(t, entity)}
+	pkg := testPackage(t, "export PATH")
+
+	if err := Sign([]Package{pkg}, opts); err != nil {
+		t.Fatalf("Sign returned error: %s", err)
+	}
+
+	tampered := pkg
+	tampered.files = []PackageFile{{path: ".bashrc", digest: hashBytes([]byte("export PATH=modified"))}}
+	if err := verifyPackageSignature(tampered, opts); err == nil {
+		t.Error("verifyPackageSignature accepted a package whose manifest no longer matches the signature")
+	}
+}
+
+func TestVerifyPackageSignatureRejectsUnknownSigner(t *testing.T) {
+	signer, err := keyring.NewKeyPair("Signer", "", "signer@example.com")
+	if err != nil {
+		t.Fatalf("NewKeyPair returned error: %s", err)
+	}
+	other, err := keyring.NewKeyPair("Someone Else", "", "other@example.com")
+	if err != nil {
+		t.Fatalf("NewKeyPair returned error: %s", err)
+	}
+	pkg := testPackage(t, "export PATH")
+
+	if err := Sign([]Package{pkg}, &Options{Keyring: writeKeyringDir(t, signer)}); err != nil {
+		t.Fatalf("Sign returned error: %s", err)
+	}
+
+	untrustingOpts := &Options{Keyring: writeKeyringDir(t, other)}
+	if err := verifyPackageSignature(pkg, untrustingOpts); err == nil {
+		t.Error("verifyPackageSignature accepted a signature from a signer missing from the keyring")
+	}
+}
+
+func TestPackageManifestTextIsSortedByPath(t *testing.T) {
+	pkg := Package{
+		name: "shell",
+		files: []PackageFile{
+			{path: ".zshrc", digest: "zdigest"},
+			{path: ".bashrc", digest: "bdigest"},
+		},
+	}
+
+	want := "bdigest  .bashrc\nzdigest  .zshrc\n"
+	got := string(packageManifestText(pkg))
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
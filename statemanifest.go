@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	STATE_DIRECTORY = ".magus"
+	STATE_FILE_NAME = "state.json"
+
+	DRIFT_MODIFIED            = "MODIFIED"
+	DRIFT_DELETED             = "DELETED"
+	DRIFT_REPLACED_BY_SYMLINK = "REPLACED_BY_SYMLINK"
+)
+
+// FileDigest is the content-addressable record for one installed file: its
+// path relative to Target, its mode bits, and the folded digest mixing both
+// with its content hash.
+type FileDigest struct {
+	Path      string `json:"path"`
+	Mode      uint32 `json:"mode"`
+	IsSymlink bool   `json:"is_symlink"`
+	Digest    string `json:"digest"`
+}
+
+// PackageDigest folds a package's sorted FileDigests into a single recursive
+// digest, inspired by buildkit's contenthash.
+type PackageDigest struct {
+	Name   string       `json:"name"`
+	Digest string       `json:"digest"`
+	Files  []FileDigest `json:"files"`
+}
+
+// StateManifest is magus's content-addressable record of what it installed,
+// persisted as Target/.magus/state.json after every conjure/expel.
+type StateManifest struct {
+	Digest   string          `json:"digest"`
+	Packages []PackageDigest `json:"packages"`
+}
+
+// hashFile streams path's content through SHA-256 rather than reading it
+// fully into memory, so dotfile repos with large binary assets (fonts,
+// wallpapers) don't blow up RSS.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashBytes hashes an in-memory buffer, used to mix small metadata values
+// (paths, mode bits, symlink targets) into the manifest digests.
+func hashBytes(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// foldFileDigest mixes a file's path, mode bits, and content digest into a
+// single digest, so a rename or permission change is detected the same way
+// as a content change.
+func foldFileDigest(path string, mode uint32, contentDigest string) string {
+	return hashBytes([]byte(fmt.Sprintf("%s\x00%o\x00%s", path, mode, contentDigest)))
+}
+
+// foldPackageDigest folds a package's file digests, sorted by path, into one
+// recursive digest.
+func foldPackageDigest(files []FileDigest) string {
+	sorted := append([]FileDigest{}, files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+	acc := ""
+	for _, f := range sorted {
+		acc = hashBytes([]byte(acc + f.Digest))
+	}
+	return acc
+}
+
+// foldRepoDigest folds package digests, sorted by name, into a single repo
+// digest.
+func foldRepoDigest(pkgs []PackageDigest) string {
+	sorted := append([]PackageDigest{}, pkgs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	acc := ""
+	for _, p := range sorted {
+		acc = hashBytes([]byte(acc + p.Digest))
+	}
+	return acc
+}
+
+// fileDigestOnDisk computes the folded digest for targetPath/relPath as it
+// actually sits on disk right now, hashing symlink destinations instead of
+// following them.
+func fileDigestOnDisk(targetPath string, relPath string) (FileDigest, error) {
+	fullPath := fmt.Sprintf("%s/%s", targetPath, relPath)
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return FileDigest{}, err
+	}
+	isSymlink := info.Mode()&os.ModeSymlink != 0
+	var contentDigest string
+	if isSymlink {
+		dest, err := os.Readlink(fullPath)
+		if err != nil {
+			return FileDigest{}, err
+		}
+		contentDigest = hashBytes([]byte("symlink:" + dest))
+	} else {
+		contentDigest, err = hashFile(fullPath)
+		if err != nil {
+			return FileDigest{}, err
+		}
+	}
+	mode := uint32(info.Mode().Perm())
+	return FileDigest{
+		Path:      relPath,
+		Mode:      mode,
+		IsSymlink: isSymlink,
+		Digest:    foldFileDigest(relPath, mode, contentDigest),
+	}, nil
+}
+
+// buildStateManifest computes the content-addressable manifest for pkgs as
+// they are actually installed at targetPath. Files no longer present (e.g.
+// just expelled) are simply omitted rather than treated as an error.
+func buildStateManifest(pkgs []Package, targetPath string) (StateManifest, error) {
+	pkgDigests := make([]PackageDigest, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		fileDigests := make([]FileDigest, 0, len(pkg.files))
+		for _, fn := range pkg.files {
+			digest, err := fileDigestOnDisk(targetPath, fn.target)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return StateManifest{}, err
+			}
+			fileDigests = append(fileDigests, digest)
+		}
+		pkgDigests = append(pkgDigests, PackageDigest{
+			Name:   pkg.name,
+			Digest: foldPackageDigest(fileDigests),
+			Files:  fileDigests,
+		})
+	}
+	return StateManifest{
+		Digest:   foldRepoDigest(pkgDigests),
+		Packages: pkgDigests,
+	}, nil
+}
+
+// writeStateManifest persists manifest as targetPath/.magus/state.json.
+func writeStateManifest(manifest StateManifest, targetPath string) error {
+	stateDir := fmt.Sprintf("%s/%s", targetPath, STATE_DIRECTORY)
+	if err := os.MkdirAll(stateDir, 0777); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fmt.Sprintf("%s/%s", stateDir, STATE_FILE_NAME), data, 0666)
+}
+
+// readStateManifest loads the manifest previously written by
+// writeStateManifest.
+func readStateManifest(targetPath string) (StateManifest, error) {
+	data, err := os.ReadFile(fmt.Sprintf("%s/%s/%s", targetPath, STATE_DIRECTORY, STATE_FILE_NAME))
+	if err != nil {
+		return StateManifest{}, err
+	}
+	var manifest StateManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return StateManifest{}, err
+	}
+	return manifest, nil
+}
+
+// persistState recomputes pkgs' on-disk manifest and writes it to Target, so
+// that verify can later detect drift without Source present.
+func persistState(pkgs []Package, opts *Options) error {
+	manifest, err := buildStateManifest(pkgs, opts.Target)
+	if err != nil {
+		return err
+	}
+	return writeStateManifest(manifest, opts.Target)
+}
+
+// Verify subcommand: walks Target, re-hashes every file magus previously
+// installed according to the persisted state manifest, and reports drift
+// without needing the Source tree present. The returned bool reports
+// whether any drift was found, so callers can distinguish "ran cleanly, no
+// drift" from "ran cleanly, found drift".
+func Verify(opts *Options) (bool, error) {
+	manifest, err := readStateManifest(opts.Target)
+	if err != nil {
+		return false, err
+	}
+	drifted := false
+	for _, pkg := range manifest.Packages {
+		for _, fn := range pkg.Files {
+			fullPath := fmt.Sprintf("%s/%s", opts.Target, fn.Path)
+			_, err := os.Lstat(fullPath)
+			if errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintf(os.Stdout, "  [%s] %s: %s\n", pkg.Name, fn.Path, DRIFT_DELETED)
+				drifted = true
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+
+			current, err := fileDigestOnDisk(opts.Target, fn.Path)
+			if err != nil {
+				return false, err
+			}
+			if current.Digest == fn.Digest {
+				continue
+			}
+			drifted = true
+			if !fn.IsSymlink && current.IsSymlink {
+				fmt.Fprintf(os.Stdout, "  [%s] %s: %s\n", pkg.Name, fn.Path, DRIFT_REPLACED_BY_SYMLINK)
+				continue
+			}
+			fmt.Fprintf(os.Stdout, "  [%s] %s: %s\n", pkg.Name, fn.Path, DRIFT_MODIFIED)
+		}
+	}
+	if !drifted {
+		fmt.Fprintf(os.Stdout, ".:. No drift detected\n")
+	}
+	return drifted, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFoldPackageDigestIsOrderIndependent(t *testing.T) {
+	a := []FileDigest{{Path: "a", Digest: "1"}, {Path: "b", Digest: "2"}}
+	b := []FileDigest{{Path: "b", Digest: "2"}, {Path: "a", Digest: "1"}}
+
+	if foldPackageDigest(a) != foldPackageDigest(b) {
+		t.Error("foldPackageDigest should be independent of input order")
+	}
+}
+
+func TestFoldFileDigestDetectsModeChange(t *testing.T) {
+	contentDigest := hashBytes([]byte("content"))
+	a := foldFileDigest(".bashrc", 0644, contentDigest)
+	b := foldFileDigest(".bashrc", 0600, contentDigest)
+
+	if a == b {
+		t.Error("foldFileDigest should fold mode bits into the digest")
+	}
+}
+
+func TestBuildAndReadStateManifestRoundTrip(t *testing.T) {
+	target := t.TempDir()
+	if err := os.WriteFile(filepath.Join(target, ".bashrc"), []byte("export PATH"), 0644); err != nil {
+		t.Fatalf("failed to set up fixture: %s", err)
+	}
+	pkgs := []Package{
+		{name: "shell", files: []PackageFile{{path: ".bashrc", target: ".bashrc"}}},
+	}
+
+	manifest, err := buildStateManifest(pkgs, target)
+	if err != nil {
+		t.Fatalf("buildStateManifest returned error: %s", err)
+	}
+	if err := writeStateManifest(manifest, target); err != nil {
+		t.Fatalf("writeStateManifest returned error: %s", err)
+	}
+
+	got, err := readStateManifest(target)
+	if err != nil {
+		t.Fatalf("readStateManifest returned error: %s", err)
+	}
+	if got.Digest != manifest.Digest {
+		t.Errorf("got repo digest %s, want %s", got.Digest, manifest.Digest)
+	}
+}
+
+func TestVerifyDetectsDrift(t *testing.T) {
+	target := t.TempDir()
+	filePath := filepath.Join(target, ".bashrc")
+	if err := os.WriteFile(filePath, []byte("export PATH"), 0644); err != nil {
+		t.Fatalf("failed to set up fixture: %s", err)
+	}
+	pkgs := []Package{
+		{name: "shell", files: []PackageFile{{path: ".bashrc", target: ".bashrc"}}},
+	}
+	manifest, err := buildStateManifest(pkgs, target)
+	if err != nil {
+		t.Fatalf("buildStateManifest returned error: %s", err)
+	}
+	if err := writeStateManifest(manifest, target); err != nil {
+		t.Fatalf("writeStateManifest returned error: %s", err)
+	}
+
+	if err := os.WriteFile(filePath, []byte("export PATH=modified"), 0644); err != nil {
+		t.Fatalf("failed to modify fixture: %s", err)
+	}
+
+	drifted, err := Verify(&Options{Target: target})
+	if err != nil {
+		t.Fatalf("Verify returned error: %s", err)
+	}
+	if !drifted {
+		t.Error("Verify did not report drift for a modified file")
+	}
+}
+
+func TestVerifyReportsNoDriftWhenUnmodified(t *testing.T) {
+	target := t.TempDir()
+	if err := os.WriteFile(filepath.Join(target, ".bashrc"), []byte("export PATH"), 0644); err != nil {
+		t.Fatalf("failed to set up fixture: %s", err)
+	}
+	pkgs := []Package{
+		{name: "shell", files: []PackageFile{{path: ".bashrc", target: ".bashrc"}}},
+	}
+	manifest, err := buildStateManifest(pkgs, target)
+	if err != nil {
+		t.Fatalf("buildStateManifest returned error: %s", err)
+	}
+	if err := writeStateManifest(manifest, target); err != nil {
+		t.Fatalf("writeStateManifest returned error: %s", err)
+	}
+
+	drifted, err := Verify(&Options{Target: target})
+	if err != nil {
+		t.Fatalf("Verify returned error: %s", err)
+	}
+	if drifted {
+		t.Error("Verify reported drift for an unmodified file")
+	}
+}
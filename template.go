@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+const TEMPLATE_SUFFIX = ".tmpl"
+
+// TemplateContext is exposed to .tmpl files so one dotfiles repo can serve
+// several host profiles without branching.
+type TemplateContext struct {
+	Host string
+	OS   string
+	Arch string
+	User string
+	Env  map[string]string
+	Vars map[string]interface{}
+}
+
+// isTemplateFile reports whether path is rendered through text/template
+// before being installed.
+func isTemplateFile(path string) bool {
+	return strings.HasSuffix(path, TEMPLATE_SUFFIX)
+}
+
+// templateInstallPath strips the .tmpl suffix, the path a template's
+// rendered output is installed at.
+func templateInstallPath(path string) string {
+	return strings.TrimSuffix(path, TEMPLATE_SUFFIX)
+}
+
+// buildTemplateContext gathers the host facts and user-supplied variables
+// available to every .tmpl file in this run.
+func buildTemplateContext(homeDir string) (TemplateContext, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return TemplateContext{}, err
+	}
+	currentUser, err := user.Current()
+	if err != nil {
+		return TemplateContext{}, err
+	}
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		env[key] = value
+	}
+	vars, err := loadVars(homeDir, host)
+	if err != nil {
+		return TemplateContext{}, err
+	}
+	return TemplateContext{
+		Host: host,
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+		User: currentUser.Username,
+		Env:  env,
+		Vars: vars,
+	}, nil
+}
+
+// loadVars reads ~/.config/magus/vars.yaml and layers per-host overrides
+// from vars.<host>.yaml on top, so a single key can be tuned per machine.
+func loadVars(homeDir string, host string) (map[string]interface{}, error) {
+	vars := make(map[string]interface{})
+	paths := []string{
+		fmt.Sprintf("%s/.config/magus/vars.yaml", homeDir),
+		fmt.Sprintf("%s/.config/magus/vars.%s.yaml", homeDir, host),
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var overlay map[string]interface{}
+		if err := yaml.Unmarshal(data, &overlay); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for key, value := range overlay {
+			vars[key] = value
+		}
+	}
+	return vars, nil
+}
+
+// renderTemplateFile renders the .tmpl file at sourcePath against ctx.
+// main's state pass (before determineState) and Conjure (via
+// renderAndWriteFile) both call this so the hashed digest always matches the
+// bytes actually installed.
+func renderTemplateFile(sourcePath string, ctx TemplateContext) ([]byte, error) {
+	raw, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(sourcePath)).Parse(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("parsing template %s: %w", sourcePath, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ctx); err != nil {
+		return nil, fmt.Errorf("rendering template %s: %w", sourcePath, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestIsTemplateFile(t *testing.T) {
+	cases := map[string]bool{
+		".bashrc":      false,
+		".gitconfig.tmpl": true,
+		"config/nvim/init.lua.tmpl": true,
+	}
+	for path, want := range cases {
+		if got := isTemplateFile(path); got != want {
+			t.Errorf("isTemplateFile(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestTemplateInstallPath(t *testing.T) {
+	got := templateInstallPath(".gitconfig.tmpl")
+	want := ".gitconfig"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestRenderTemplateFileIsDeterministic(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/greeting.tmpl"
+	if err := os.WriteFile(path, []byte("hello {{ .Host }}"), 0666); err != nil {
+		t.Fatalf("os.WriteFile returned error: %s", err)
+	}
+
+	ctx := TemplateContext{Host: "workstation"}
+	first, err := renderTemplateFile(path, ctx)
+	if err != nil {
+		t.Fatalf("renderTemplateFile returned error: %s", err)
+	}
+	second, err := renderTemplateFile(path, ctx)
+	if err != nil {
+		t.Fatalf("renderTemplateFile returned error: %s", err)
+	}
+	if string(first) != "hello workstation" {
+		t.Errorf("got %q, want %q", first, "hello workstation")
+	}
+	if string(first) != string(second) {
+		t.Errorf("renderTemplateFile was not deterministic: %q != %q", first, second)
+	}
+}